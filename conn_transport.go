@@ -0,0 +1,211 @@
+package lua_debugger
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/edolphin-ydf/gopherlua-debugger/logger"
+	"github.com/edolphin-ydf/gopherlua-debugger/proto"
+)
+
+// connTransport implements the stream-oriented half of Transport shared by
+// TcpTransport and UnixTransport: both speak the same length-prefixed proto
+// framing over a net.Conn, and differ only in how that conn is dialed or
+// accepted.
+type connTransport struct {
+	handler func(cmd int, req interface{})
+
+	// connM guards conn, doneCh, pongCh, closeHandler and reconnectHandler:
+	// bind reassigns the former three wholesale on every reconnect, and
+	// Facade sets the latter two only after dial has already started the
+	// read loop, while Send, Close, Stop, Wait and readLoop read all five
+	// from other goroutines. writeM is separate: it only serializes the
+	// bytes of concurrent Send calls against the conn connM last published.
+	connM            sync.Mutex
+	conn             net.Conn
+	doneCh           chan struct{}
+	pongCh           chan struct{}
+	closeHandler     func()
+	reconnectHandler func()
+
+	writeM sync.Mutex
+
+	running atomic.Bool
+
+	// redial re-establishes conn for keepalive's reconnect. It is set by
+	// Connect (where we know how to dial again) and left nil by Listen
+	// (the IDE dialed us; there is nothing for us to redial).
+	redial func() (net.Conn, error)
+}
+
+func (c *connTransport) SetHandler(handler func(cmd int, req interface{})) {
+	c.handler = handler
+}
+
+func (c *connTransport) SetCloseHandler(handler func()) {
+	c.connM.Lock()
+	defer c.connM.Unlock()
+	c.closeHandler = handler
+}
+
+func (c *connTransport) SetReconnectHandler(handler func()) {
+	c.connM.Lock()
+	defer c.connM.Unlock()
+	c.reconnectHandler = handler
+}
+
+func (c *connTransport) bind(conn net.Conn) {
+	c.connM.Lock()
+	c.conn = conn
+	c.doneCh = make(chan struct{})
+	c.pongCh = make(chan struct{}, 1)
+	c.connM.Unlock()
+	go c.readLoop(conn)
+}
+
+func (c *connTransport) readLoop(conn net.Conn) {
+	c.connM.Lock()
+	doneCh, pongCh := c.doneCh, c.pongCh
+	c.connM.Unlock()
+	// Deferred LIFO: closeHandler (Facade's unsubscribe) must run before
+	// doneCh closes, so closeAndWait can rely on it having already run by
+	// the time doneCh is observed closed.
+	defer close(doneCh)
+	defer func() {
+		c.connM.Lock()
+		closeHandler := c.closeHandler
+		c.connM.Unlock()
+		if closeHandler != nil {
+			closeHandler()
+		}
+	}()
+	r := bufio.NewReader(conn)
+	for {
+		cmd, msg, err := readMsg(r)
+		if err != nil {
+			logger.Tracef(logger.CategoryTransport, "read loop exiting: %v", err)
+			return
+		}
+		// Keepalive pongs are consumed here; they never reach Facade.
+		if cmd == proto.MsgIdPongRsp {
+			select {
+			case pongCh <- struct{}{}:
+			default:
+			}
+			continue
+		}
+		if c.handler != nil {
+			c.handler(cmd, msg)
+		}
+	}
+}
+
+func (c *connTransport) Send(cmd int, msg interface{}) error {
+	c.connM.Lock()
+	conn := c.conn
+	c.connM.Unlock()
+	if conn == nil {
+		return fmt.Errorf("transport: not connected")
+	}
+
+	c.writeM.Lock()
+	defer c.writeM.Unlock()
+	logger.Tracef(logger.CategoryTransport, "send cmd=%d", cmd)
+	return writeMsg(conn, cmd, msg)
+}
+
+func (c *connTransport) Close() error {
+	c.connM.Lock()
+	conn := c.conn
+	c.connM.Unlock()
+	if conn == nil {
+		return nil
+	}
+	return conn.Close()
+}
+
+func (c *connTransport) Start(ctx context.Context) error {
+	c.running.Store(true)
+	return nil
+}
+
+func (c *connTransport) Stop(ctx context.Context) error {
+	if !c.running.CompareAndSwap(true, false) {
+		return nil
+	}
+	if err := c.Close(); err != nil {
+		return err
+	}
+
+	c.connM.Lock()
+	doneCh := c.doneCh
+	c.connM.Unlock()
+	if doneCh == nil {
+		return nil
+	}
+	select {
+	case <-doneCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *connTransport) Wait() {
+	c.connM.Lock()
+	doneCh := c.doneCh
+	c.connM.Unlock()
+	if doneCh != nil {
+		<-doneCh
+	}
+}
+
+// closeAndWait closes the current connection and blocks until its read loop
+// (and the closeHandler it runs) has fully exited, so a subsequent bind
+// can't race the old loop's access to doneCh/pongCh and callers can rely on
+// closeHandler having already run before they act on the close.
+func (c *connTransport) closeAndWait() {
+	c.connM.Lock()
+	doneCh := c.doneCh
+	c.connM.Unlock()
+	c.Close()
+	if doneCh != nil {
+		<-doneCh
+	}
+}
+
+func (c *connTransport) IsRunning() bool {
+	return c.running.Load()
+}
+
+// readMsg and writeMsg encode/decode the length-prefixed proto wire format
+// shared by the stream-based transports.
+func readMsg(r *bufio.Reader) (int, interface{}, error) {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return 0, nil, err
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, nil, err
+	}
+	return proto.Unmarshal(buf)
+}
+
+func writeMsg(w io.Writer, cmd int, msg interface{}) error {
+	buf, err := proto.Marshal(cmd, msg)
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, uint32(len(buf))); err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
@@ -0,0 +1,74 @@
+package lua_debugger
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestKeepaliveReconnectRebindsAndNotifies exercises connTransport's missed-
+// pong reconnect path end to end over real TCP loopback: a connection that
+// never sees a pong should close, redial, and fire reconnectHandler once the
+// new connection is bound. It is the regression test for the data race on
+// conn/doneCh/pongCh during bind and for reconnectHandler never firing.
+func TestKeepaliveReconnectRebindsAndNotifies(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan struct{}, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- struct{}{}
+			go func() {
+				buf := make([]byte, 256)
+				for {
+					if _, err := conn.Read(buf); err != nil {
+						conn.Close()
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	client := &TcpTransport{}
+	if err := client.Connect(ln.Addr().String()); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer client.Stop(context.Background())
+
+	select {
+	case <-accepted:
+	case <-time.After(time.Second):
+		t.Fatal("server never accepted the initial connection")
+	}
+
+	reconnected := make(chan struct{})
+	client.SetReconnectHandler(func() { close(reconnected) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The server never answers a ping, so the very first tick misses its
+	// pong and forces a close+redial.
+	client.EnableKeepalive(ctx, 20*time.Millisecond, 1, true)
+
+	select {
+	case <-accepted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("keepalive never redialed after the missed pong")
+	}
+
+	select {
+	case <-reconnected:
+	case <-time.After(time.Second):
+		t.Fatal("reconnectHandler was never called after a successful redial")
+	}
+}
@@ -0,0 +1,180 @@
+package lua_debugger
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/edolphin-ydf/gopherlua-debugger/proto"
+)
+
+// BreakPoint is a single file:line breakpoint, optionally guarded by a
+// condition expression evaluated in the paused Lua state.
+type BreakPoint struct {
+	File      string
+	Condition string
+	Line      int
+}
+
+func breakPointKey(file string, line int) string {
+	return fmt.Sprintf("%s:%d", file, line)
+}
+
+// EvalContext carries a watch/eval request from the IDE through to its
+// result, which is then reported back via Facade.OnEvalResult.
+type EvalContext struct {
+	Expr       string
+	Seq        int
+	StackLevel int
+	Depth      int
+	CacheId    int
+	Success    bool
+	Error      string
+	Result     *Variable
+}
+
+// Variable is a single local/upvalue reported in a break notification or
+// eval result.
+type Variable struct {
+	Name  string
+	Value string
+	Type  string
+}
+
+func (v *Variable) toProto() *proto.Variable {
+	return &proto.Variable{Name: v.Name, Value: v.Value, Type: v.Type}
+}
+
+// Stack is one frame of the Lua call stack at a breakpoint hit.
+type Stack struct {
+	Level            int
+	File             string
+	FunctionName     string
+	Line             int
+	LocalVariables   []*Variable
+	UpvalueVariables []*Variable
+}
+
+// Debugger owns the breakpoint set and the attached Lua states, and
+// evaluates break/eval requests against them. It is driven entirely through
+// Facade, which owns its lifecycle.
+type Debugger struct {
+	fcd      *Facade
+	ExtNames []string
+
+	bpM         sync.Mutex
+	breakpoints map[string]*BreakPoint
+	helperCode  string
+
+	lifecycleM sync.Mutex
+	ctx        context.Context
+	cancel     context.CancelFunc
+	doneCh     chan struct{}
+}
+
+func newDebugger() *Debugger {
+	return &Debugger{
+		breakpoints: make(map[string]*BreakPoint),
+	}
+}
+
+// LoadHelper installs the emmy helper Lua code used to instrument
+// breakpoints. It used to be named Start before the Debugger grew a proper
+// Start/Stop/Wait service lifecycle below.
+func (d *Debugger) LoadHelper(helperCode string) {
+	d.bpM.Lock()
+	defer d.bpM.Unlock()
+	d.helperCode = helperCode
+}
+
+// Start begins the Debugger's background work under ctx. Stop(ctx) cancels
+// it and Wait() blocks until it has fully exited.
+func (d *Debugger) Start(ctx context.Context) error {
+	d.lifecycleM.Lock()
+	defer d.lifecycleM.Unlock()
+	if d.ctx != nil && d.ctx.Err() == nil {
+		return nil
+	}
+	d.ctx, d.cancel = context.WithCancel(ctx)
+	done, ctxDone := make(chan struct{}), d.ctx.Done()
+	d.doneCh = done
+	go func() {
+		<-ctxDone
+		close(done)
+	}()
+	return nil
+}
+
+// Stop cancels the Debugger's context and waits for it to exit or ctx to
+// expire first.
+func (d *Debugger) Stop(ctx context.Context) error {
+	d.lifecycleM.Lock()
+	cancel := d.cancel
+	done := d.doneCh
+	d.lifecycleM.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Wait blocks until the Debugger has stopped.
+func (d *Debugger) Wait() {
+	d.lifecycleM.Lock()
+	done := d.doneCh
+	d.lifecycleM.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// IsRunning reports whether Start has been called without a matching Stop.
+func (d *Debugger) IsRunning() bool {
+	d.lifecycleM.Lock()
+	defer d.lifecycleM.Unlock()
+	return d.ctx != nil && d.ctx.Err() == nil
+}
+
+func (d *Debugger) Attach(L *lua.LState) {
+	// Instrumentation hooks are installed lazily on first breakpoint hit;
+	// nothing to do here beyond tracking that the state is known.
+}
+
+func (d *Debugger) AddBreakPoint(bp *BreakPoint) {
+	d.bpM.Lock()
+	defer d.bpM.Unlock()
+	d.breakpoints[breakPointKey(bp.File, bp.Line)] = bp
+}
+
+func (d *Debugger) RemoveBreakPoint(file string, line int) {
+	d.bpM.Lock()
+	defer d.bpM.Unlock()
+	delete(d.breakpoints, breakPointKey(file, line))
+}
+
+func (d *Debugger) RemoveAllBreakpoints() {
+	d.bpM.Lock()
+	defer d.bpM.Unlock()
+	d.breakpoints = make(map[string]*BreakPoint)
+}
+
+func (d *Debugger) DoAction(action int) {
+	// Resume/step/pause dispatch happens against the currently broken
+	// Lua state; wiring that up is outside the scope of this package slice.
+}
+
+func (d *Debugger) Eval(ctx *EvalContext) {
+	d.fcd.OnEvalResult(ctx)
+}
+
+func (d *Debugger) GetStacks(L *lua.LState) []*Stack {
+	return nil
+}
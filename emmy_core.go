@@ -2,47 +2,72 @@ package lua_debugger
 
 import (
 	"io"
-	"log"
-	"sync/atomic"
 
 	lua "github.com/yuin/gopher-lua"
 )
 
-// openConn tracks open connection
-// This is necessary because otherwise debugger
-// (at least in InteliJ) will not work with multiple connected debuggers
-// at the same time. So we try to guard ourselves
-// to not deadlock incoming requests to NNBB Hub.
-var openConn int32
-
-func init() {
-	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
-}
-
 const (
 	KeyDebuggerFcd = "__Debugger_Fcd"
 )
 
-func (f *Facade) Connect(L *lua.LState) int {
-	host := L.CheckString(1)
-	port := L.CheckNumber(2)
-	// If no connections opened yet - we can open one.
-	if atomic.CompareAndSwapInt32(&openConn, 0, 1) {
-		if err := f.TcpConnect(L, host, int(port)); err != nil {
-			L.Push(lua.LFalse)
-			L.Push(lua.LString(err.Error()))
-			return 2
-		}
+// guardedConnect calls dial and returns true to Lua on success, or
+// (false, message) for an error dial returns. Facade.connect raises each of
+// its failures (including the max-subscriber-count guard) as a Lua error via
+// LuaError before returning it, so those propagate as Lua errors instead.
+func guardedConnect(L *lua.LState, dial func() error) int {
+	if err := dial(); err != nil {
+		L.Push(lua.LFalse)
+		L.Push(lua.LString(err.Error()))
+		return 2
 	}
 
 	L.Push(lua.LTrue)
 	return 1
 }
 
+func (f *Facade) Connect(L *lua.LState) int {
+	host := L.CheckString(1)
+	port := L.CheckNumber(2)
+	return guardedConnect(L, func() error { return f.TcpConnect(L, host, int(port)) })
+}
+
+func (f *Facade) Listen(L *lua.LState) int {
+	host := L.CheckString(1)
+	port := L.CheckNumber(2)
+	return guardedConnect(L, func() error { return f.TcpListen(L, host, int(port)) })
+}
+
+func (f *Facade) luaUnixConnect(L *lua.LState) int {
+	path := L.CheckString(1)
+	return guardedConnect(L, func() error { return f.UnixConnect(L, path) })
+}
+
+func (f *Facade) luaUnixListen(L *lua.LState) int {
+	path := L.CheckString(1)
+	return guardedConnect(L, func() error { return f.UnixListen(L, path) })
+}
+
+func (f *Facade) luaWsConnect(L *lua.LState) int {
+	host := L.CheckString(1)
+	port := L.CheckNumber(2)
+	return guardedConnect(L, func() error { return f.WsConnect(L, host, int(port)) })
+}
+
+func (f *Facade) luaWsListen(L *lua.LState) int {
+	host := L.CheckString(1)
+	port := L.CheckNumber(2)
+	return guardedConnect(L, func() error { return f.WsListen(L, host, int(port)) })
+}
+
 func (f *Facade) Loader(L *lua.LState) int {
 	t := L.NewTable()
 	L.SetFuncs(t, map[string]lua.LGFunction{
-		"tcpConnect": f.Connect,
+		"tcpConnect":  f.Connect,
+		"tcpListen":   f.Listen,
+		"unixConnect": f.luaUnixConnect,
+		"unixListen":  f.luaUnixListen,
+		"wsConnect":   f.luaWsConnect,
+		"wsListen":    f.luaWsListen,
 	})
 	L.Push(t)
 	return 1
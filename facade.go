@@ -2,15 +2,30 @@ package lua_debugger
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	lua "github.com/yuin/gopher-lua"
 
+	"github.com/edolphin-ydf/gopherlua-debugger/logger"
 	"github.com/edolphin-ydf/gopherlua-debugger/proto"
 )
 
+// maxSubscribers bounds how many transports (IDE, monitor, ...) can observe
+// one debuggee at once.
+const maxSubscribers = 8
+
+// Default keepalive configuration applied to every transport connect()
+// brings up; override with SetKeepalive before connecting.
+const (
+	defaultKeepaliveInterval       = 15 * time.Second
+	defaultKeepaliveMaxMissedPongs = 3
+)
+
 func LuaError(L *lua.LState, msg string) int {
 	msg = "[Emmy]" + msg
 	f := L.GetGlobal("error")
@@ -21,77 +36,272 @@ func LuaError(L *lua.LState, msg string) int {
 }
 
 type Facade struct {
-	dbg             *Debugger
-	t               *Transport
-	m               sync.Mutex
-	cond            *sync.Cond
-	isWaitingForIDE bool
-	isIDEReady      bool
-	helperCode      string
+	dbg        *Debugger
+	readyCh    chan struct{}
+	ideReady   atomic.Bool
+	helperCode string
+
+	running atomic.Bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	doneCh  chan struct{}
+
+	subsM sync.RWMutex
+	subs  map[string]*subscriber
 
 	states map[*lua.LState]struct{}
+
+	keepaliveInterval       time.Duration
+	keepaliveMaxMissedPongs int
+	keepaliveReconnect      bool
 }
 
 func newFacade() *Facade {
 	res := &Facade{
-		dbg:    newDebugger(),
-		states: make(map[*lua.LState]struct{}),
+		dbg:     newDebugger(),
+		states:  make(map[*lua.LState]struct{}),
+		readyCh: make(chan struct{}),
+		subs:    make(map[string]*subscriber),
+
+		keepaliveInterval:       defaultKeepaliveInterval,
+		keepaliveMaxMissedPongs: defaultKeepaliveMaxMissedPongs,
+		keepaliveReconnect:      true,
 	}
-	res.cond = sync.NewCond(&res.m)
 	res.dbg.fcd = res
 
 	return res
 }
 
-func (f *Facade) TcpConnect(L *lua.LState, host string, port int) error {
+// SetKeepalive overrides the default ping/pong keepalive configuration
+// applied to every transport connect() brings up afterwards. An interval of
+// 0 disables keepalive entirely.
+func (f *Facade) SetKeepalive(interval time.Duration, maxMissedPongs int, reconnect bool) {
+	f.keepaliveInterval = interval
+	f.keepaliveMaxMissedPongs = maxMissedPongs
+	f.keepaliveReconnect = reconnect
+}
+
+func newSubscriberID() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// subscribe registers t to receive every OnBreak/OnEvalResult notification
+// alongside whichever other clients are already attached. Each subscriber
+// gets its own outbound queue and writer goroutine (see subscriber.go), so a
+// slow subscriber only ever falls behind itself.
+func (f *Facade) subscribe(t Transport) (string, error) {
+	f.subsM.Lock()
+	defer f.subsM.Unlock()
+	if len(f.subs) >= maxSubscribers {
+		return "", fmt.Errorf("lua_debugger: max %d subscribers already attached", maxSubscribers)
+	}
+	id := newSubscriberID()
+	f.subs[id] = newSubscriber(t)
+	return id, nil
+}
+
+func (f *Facade) unsubscribe(id string) {
+	f.subsM.Lock()
+	s, ok := f.subs[id]
+	delete(f.subs, id)
+	f.subsM.Unlock()
+	if ok {
+		s.close()
+	}
+}
+
+// publish hands a notification to every currently subscribed transport's
+// outbound queue, best-effort: a stuck subscriber only drops its own
+// notifications and never delays delivery to the others or blocks
+// subscribe/unsubscribe. The subscriber snapshot is taken under RLock; the
+// (non-blocking) enqueue happens outside it.
+func (f *Facade) publish(cmd int, msg interface{}) {
+	f.subsM.RLock()
+	snapshot := make([]*subscriber, 0, len(f.subs))
+	for _, s := range f.subs {
+		snapshot = append(snapshot, s)
+	}
+	f.subsM.RUnlock()
+
+	for _, s := range snapshot {
+		s.enqueue(cmd, msg)
+	}
+}
+
+// attachSubscriber subscribes t and arms its close handler to unsubscribe
+// under the id that subscribe just handed back. It is called once from
+// connect and again from the reconnect handler below every time keepalive
+// redials, since a fresh subscription needs a fresh id and close handler.
+func (f *Facade) attachSubscriber(t Transport) error {
+	id, err := f.subscribe(t)
+	if err != nil {
+		return err
+	}
+	t.SetCloseHandler(func() { f.unsubscribe(id) })
+	return nil
+}
+
+// connect wires t into the Facade as a subscriber, runs dial against it
+// (either Connect or Listen on the concrete transport), and on success
+// brings up the service lifecycle and waits for the IDE's ready handshake.
+// It is the shared tail of every {Tcp,Unix,Ws}{Connect,Listen} entry point.
+func (f *Facade) connect(L *lua.LState, t Transport, dial func(Transport) error) error {
 	f.states[L] = struct{}{}
-	f.t = &Transport{}
-	f.t.Handler = f.HandleMsg
-	if err := f.t.Connect(host, port); err != nil {
+	t.SetHandler(f.HandleMsg)
+	if err := dial(t); err != nil {
+		LuaError(L, err.Error())
+		return err
+	}
+	if err := f.attachSubscriber(t); err != nil {
+		LuaError(L, err.Error())
+		t.Close()
+		return err
+	}
+	// A keepalive-driven reconnect's close handler already unsubscribed the
+	// old id by the time this runs (see connTransport.closeAndWait), so
+	// re-subscribing here can't collide with it.
+	t.SetReconnectHandler(func() {
+		if err := f.attachSubscriber(t); err != nil {
+			logger.Warnf("facade: re-subscribe after reconnect failed: %v", err)
+		}
+	})
+
+	if err := f.Start(context.Background()); err != nil {
+		LuaError(L, err.Error())
+		t.Close()
+		return err
+	}
+	// From here on f.Start has already brought the service lifecycle up, so a
+	// failure must unwind it via f.Stop rather than just closing t, or the
+	// Facade is left IsRunning()==true with its Debugger still going.
+	if err := t.Start(f.ctx); err != nil {
 		LuaError(L, err.Error())
+		f.Stop(context.Background())
 		return err
 	}
-	waitDone := make(chan struct{}, 1)
-	if L.Context() != nil {
-		go f.stopWaitIDEIfContextCanceled(L.Context(), waitDone)
+	if err := f.WaiteIDE(L.Context(), 0); err != nil {
+		LuaError(L, err.Error())
+		f.Stop(context.Background())
+		return err
 	}
-	f.WaiteIDE(waitDone, true)
+	t.EnableKeepalive(f.ctx, f.keepaliveInterval, f.keepaliveMaxMissedPongs, f.keepaliveReconnect)
 	return nil
 }
 
-func (f *Facade) stopWaitIDEIfContextCanceled(ctx context.Context, waitDone <-chan struct{}) {
-	select {
-	case <-ctx.Done():
-		{
-			ticker := time.NewTicker(100 * time.Millisecond)
-			defer ticker.Stop()
-			for {
-				select {
-				case <-ticker.C:
-					{
-						f.cond.Broadcast()
-					}
-				case <-waitDone:
-					return
-				}
-
-			}
+func (f *Facade) TcpConnect(L *lua.LState, host string, port int) error {
+	addr := fmt.Sprintf("%s:%d", host, port)
+	return f.connect(L, &TcpTransport{}, func(t Transport) error { return t.Connect(addr) })
+}
+
+func (f *Facade) TcpListen(L *lua.LState, host string, port int) error {
+	addr := fmt.Sprintf("%s:%d", host, port)
+	return f.connect(L, &TcpTransport{}, func(t Transport) error { return t.Listen(addr) })
+}
+
+func (f *Facade) UnixConnect(L *lua.LState, path string) error {
+	return f.connect(L, &UnixTransport{}, func(t Transport) error { return t.Connect(path) })
+}
+
+func (f *Facade) UnixListen(L *lua.LState, path string) error {
+	return f.connect(L, &UnixTransport{}, func(t Transport) error { return t.Listen(path) })
+}
+
+func (f *Facade) WsConnect(L *lua.LState, host string, port int) error {
+	addr := fmt.Sprintf("%s:%d", host, port)
+	return f.connect(L, &WebSocketTransport{}, func(t Transport) error { return t.Connect(addr) })
+}
+
+func (f *Facade) WsListen(L *lua.LState, host string, port int) error {
+	addr := fmt.Sprintf("%s:%d", host, port)
+	return f.connect(L, &WebSocketTransport{}, func(t Transport) error { return t.Listen(addr) })
+}
+
+// Start brings up the Facade's service lifecycle: it owns the root context
+// that the transport read loop and the Debugger's background work run
+// under, and that Stop cancels. Start is idempotent; calling it twice
+// returns nil without resetting the root context.
+func (f *Facade) Start(ctx context.Context) error {
+	if !f.running.CompareAndSwap(false, true) {
+		return nil
+	}
+	f.ctx, f.cancel = context.WithCancel(ctx)
+	f.doneCh = make(chan struct{})
+
+	return f.dbg.Start(f.ctx)
+}
+
+// Stop cancels the root context, closes every subscribed transport and
+// joins the Debugger's goroutines, blocking until they exit or ctx expires
+// first.
+func (f *Facade) Stop(ctx context.Context) error {
+	if !f.running.CompareAndSwap(true, false) {
+		return nil
+	}
+	defer close(f.doneCh)
+	f.cancel()
+
+	f.subsM.Lock()
+	subs := f.subs
+	f.subs = make(map[string]*subscriber)
+	f.subsM.Unlock()
+	for _, s := range subs {
+		s.close()
+		if err := s.t.Stop(ctx); err != nil {
+			return err
 		}
 	}
+
+	return f.dbg.Stop(ctx)
 }
 
-func (f *Facade) WaiteIDE(done chan<- struct{}, force bool) {
-	if f.t != nil && force && !f.isWaitingForIDE && !f.isIDEReady {
-		f.isWaitingForIDE = true
-		f.m.Lock()
-		f.cond.Wait()
-		f.m.Unlock()
-		f.isWaitingForIDE = false
+// Wait blocks until a Stop initiated elsewhere has fully completed.
+func (f *Facade) Wait() {
+	if f.doneCh != nil {
+		<-f.doneCh
+	}
+}
+
+// IsRunning reports whether the Facade is between a Start and its matching
+// Stop.
+func (f *Facade) IsRunning() bool {
+	return f.running.Load()
+}
+
+// WaiteIDE blocks until the IDE sends its ready request, ctx is canceled, or
+// timeout elapses (a zero timeout disables the timeout case). It returns nil
+// as soon as the IDE is ready, including when it was already ready before
+// WaiteIDE was called.
+func (f *Facade) WaiteIDE(ctx context.Context, timeout time.Duration) error {
+	if f.ideReady.Load() {
+		return nil
+	}
+
+	var ctxDone <-chan struct{}
+	if ctx != nil {
+		ctxDone = ctx.Done()
+	}
+
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	select {
+	case <-f.readyCh:
+		return nil
+	case <-ctxDone:
+		return ctx.Err()
+	case <-timeoutCh:
+		return fmt.Errorf("lua_debugger: timed out waiting for IDE")
 	}
-	done <- struct{}{}
 }
 
 func (f *Facade) HandleMsg(cmd int, req interface{}) {
+	logger.Tracef(logger.CategoryProto, "HandleMsg cmd=%d req=%+v", cmd, req)
 	switch cmd {
 	case proto.MsgIdInitReq:
 		f.OnInitReq(req.(*proto.InitReq))
@@ -110,7 +320,7 @@ func (f *Facade) HandleMsg(cmd int, req interface{}) {
 
 func (f *Facade) OnInitReq(req *proto.InitReq) {
 	f.helperCode = req.EmmyHelper
-	f.dbg.Start(f.helperCode)
+	f.dbg.LoadHelper(f.helperCode)
 
 	for state := range f.states {
 		f.dbg.Attach(state)
@@ -120,12 +330,14 @@ func (f *Facade) OnInitReq(req *proto.InitReq) {
 }
 
 func (f *Facade) OnReadyReq() {
-	f.isIDEReady = true
-	f.cond.Broadcast()
+	if f.ideReady.CompareAndSwap(false, true) {
+		close(f.readyCh)
+	}
 }
 
 func (f *Facade) OnAddBreakPointReq(req *proto.AddBreakPointReq) {
 	if req.Clear {
+		logger.Tracef(logger.CategoryBreakpoints, "clearing all breakpoints")
 		f.dbg.RemoveAllBreakpoints()
 	}
 
@@ -135,12 +347,14 @@ func (f *Facade) OnAddBreakPointReq(req *proto.AddBreakPointReq) {
 			Condition: bpProto.Condition,
 			Line:      bpProto.Line,
 		}
+		logger.Tracef(logger.CategoryBreakpoints, "add %s:%d (condition=%q)", bp.File, bp.Line, bp.Condition)
 		f.dbg.AddBreakPoint(bp)
 	}
 }
 
 func (f *Facade) OnRemoveBreakPointReq(req *proto.RemoveBreakPointReq) {
 	for _, bp := range req.BreakPoints {
+		logger.Tracef(logger.CategoryBreakpoints, "remove %s:%d", bp.File, bp.Line)
 		f.dbg.RemoveBreakPoint(bp.File, bp.Line)
 	}
 }
@@ -150,6 +364,7 @@ func (f *Facade) OnActionReq(req *proto.ActionReq) {
 }
 
 func (f *Facade) OnEvalReq(req *proto.EvalReq) {
+	logger.Tracef(logger.CategoryEval, "eval seq=%d expr=%q stackLevel=%d", req.Seq, req.Expr, req.StackLevel)
 	context := &EvalContext{
 		Expr:       req.Expr,
 		Seq:        req.Seq,
@@ -165,7 +380,7 @@ func (f *Facade) OnEvalReq(req *proto.EvalReq) {
 func (f *Facade) OnBreak(L *lua.LState) {
 	stacks := f.dbg.GetStacks(L)
 
-	notify := proto.BreakNotify{Cmd: proto.MsgIdBreakNotify}
+	notify := proto.BreakNotify{}
 	for _, stack := range stacks {
 		s := proto.Stack{
 			Level:            stack.Level,
@@ -183,10 +398,11 @@ func (f *Facade) OnBreak(L *lua.LState) {
 		}
 		notify.Stacks = append(notify.Stacks, s)
 	}
-	f.t.Send(proto.MsgIdBreakNotify, notify)
+	f.publish(proto.MsgIdBreakNotify, notify)
 }
 
 func (f *Facade) OnEvalResult(ctx *EvalContext) {
+	logger.Tracef(logger.CategoryEval, "eval result seq=%d success=%t error=%q", ctx.Seq, ctx.Success, ctx.Error)
 	rsp := proto.EvalRsp{
 		Seq:     ctx.Seq,
 		Success: ctx.Success,
@@ -196,18 +412,14 @@ func (f *Facade) OnEvalResult(ctx *EvalContext) {
 		rsp.Value = ctx.Result.toProto()
 	}
 
-	f.t.Send(proto.MsgIdEvalRsp, rsp)
+	f.publish(proto.MsgIdEvalRsp, rsp)
 }
 
+// Close stops the Facade, tearing down every subscriber. It is the thin,
+// context-less wrapper embedders without their own shutdown context call on
+// unload.
 func (f *Facade) Close() error {
-	if f.t != nil {
-		// It is safe to not do CaS here because we only have one
-		// debugger instance that holds this
-		// openConn "lock" at any point of time.
-		atomic.StoreInt32(&openConn, 0)
-		f.states = nil
-		return f.t.Close()
-	}
-
-	return nil
+	err := f.Stop(context.Background())
+	f.states = nil
+	return err
 }
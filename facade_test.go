@@ -0,0 +1,101 @@
+package lua_debugger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/edolphin-ydf/gopherlua-debugger/proto"
+)
+
+// fakeTransport is a Transport test double whose Close synchronously runs
+// closeHandler, mirroring how connTransport/WebSocketTransport's read loop
+// calls it once the connection drops. Tests drive reconnects by calling
+// Close followed by reconnectHandler directly, the same sequence
+// connTransport.keepaliveLoop follows internally (closeAndWait, then
+// reconnectWithBackoff, which calls reconnectHandler).
+type fakeTransport struct {
+	closeHandler     func()
+	reconnectHandler func()
+	sent             chan int
+}
+
+func (f *fakeTransport) Connect(addr string) error { return nil }
+func (f *fakeTransport) Listen(addr string) error  { return nil }
+func (f *fakeTransport) Send(cmd int, msg interface{}) error {
+	if f.sent != nil {
+		f.sent <- cmd
+	}
+	return nil
+}
+func (f *fakeTransport) Close() error {
+	if f.closeHandler != nil {
+		f.closeHandler()
+	}
+	return nil
+}
+func (f *fakeTransport) SetHandler(handler func(cmd int, req interface{})) {}
+func (f *fakeTransport) SetCloseHandler(handler func())                    { f.closeHandler = handler }
+func (f *fakeTransport) SetReconnectHandler(handler func())                { f.reconnectHandler = handler }
+func (f *fakeTransport) Start(ctx context.Context) error                   { return nil }
+func (f *fakeTransport) Stop(ctx context.Context) error                    { return nil }
+func (f *fakeTransport) Wait()                                             {}
+func (f *fakeTransport) IsRunning() bool                                   { return true }
+func (f *fakeTransport) EnableKeepalive(ctx context.Context, interval time.Duration, maxMissedPongs int, reconnect bool) {
+}
+
+// TestReconnectResubscribes is the regression test for a reconnected
+// transport being orphaned from the pub/sub: a missed-pong close unsubscribes
+// it (via closeHandler), and the subsequent reconnect must re-subscribe it
+// (via reconnectHandler) so OnBreak/OnEvalResult reach it again.
+func TestReconnectResubscribes(t *testing.T) {
+	f := newFacade()
+	ft := &fakeTransport{sent: make(chan int, 1)}
+
+	if err := f.attachSubscriber(ft); err != nil {
+		t.Fatalf("attachSubscriber: %v", err)
+	}
+	ft.SetReconnectHandler(func() {
+		if err := f.attachSubscriber(ft); err != nil {
+			t.Errorf("attachSubscriber on reconnect: %v", err)
+		}
+	})
+
+	if got := len(f.subs); got != 1 {
+		t.Fatalf("subs after initial attach = %d, want 1", got)
+	}
+
+	// Simulate a missed-pong close: the transport's own close handler fires
+	// synchronously, same as connTransport's readLoop defer.
+	ft.Close()
+	if got := len(f.subs); got != 0 {
+		t.Fatalf("subs after close = %d, want 0", got)
+	}
+
+	// publish while unsubscribed must not reach the transport.
+	f.publish(proto.MsgIdBreakNotify, proto.BreakNotify{})
+	select {
+	case <-ft.sent:
+		t.Fatal("publish delivered a notification to an unsubscribed transport")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Simulate the redial succeeding: reconnectWithBackoff calls
+	// reconnectHandler once bind returns.
+	ft.reconnectHandler()
+	if got := len(f.subs); got != 1 {
+		t.Fatalf("subs after reconnect = %d, want 1 (transport should be re-subscribed)", got)
+	}
+
+	// The whole point of re-subscribing: OnBreak's publish must reach the
+	// transport again.
+	f.publish(proto.MsgIdBreakNotify, proto.BreakNotify{})
+	select {
+	case cmd := <-ft.sent:
+		if cmd != proto.MsgIdBreakNotify {
+			t.Fatalf("sent cmd = %d, want %d", cmd, proto.MsgIdBreakNotify)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("publish never reached the re-subscribed transport")
+	}
+}
@@ -0,0 +1,114 @@
+package lua_debugger
+
+import (
+	"context"
+	"time"
+
+	"github.com/edolphin-ydf/gopherlua-debugger/logger"
+	"github.com/edolphin-ydf/gopherlua-debugger/proto"
+)
+
+// defaultKeepaliveBackoff is the starting delay between redial attempts;
+// it doubles on every failed attempt up to maxKeepaliveBackoff.
+const (
+	defaultKeepaliveBackoff = 500 * time.Millisecond
+	maxKeepaliveBackoff     = 30 * time.Second
+)
+
+// EnableKeepalive implements Transport.EnableKeepalive for connTransport
+// (TcpTransport, UnixTransport). Debugger.breakpoints lives independent of
+// any Transport, so a successful reconnect automatically picks the existing
+// breakpoint set back up without a separate snapshot/restore step.
+func (c *connTransport) EnableKeepalive(ctx context.Context, interval time.Duration, maxMissedPongs int, reconnect bool) {
+	if interval <= 0 {
+		return
+	}
+	if maxMissedPongs <= 0 {
+		maxMissedPongs = 1
+	}
+	go c.keepaliveLoop(ctx, interval, maxMissedPongs, reconnect)
+}
+
+func (c *connTransport) keepaliveLoop(ctx context.Context, interval time.Duration, maxMissedPongs int, reconnect bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	missed := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := c.Send(proto.MsgIdPingReq, &proto.PingReq{}); err != nil {
+			logger.Tracef(logger.CategoryTransport, "keepalive: ping failed: %v", err)
+		}
+
+		c.connM.Lock()
+		pongCh := c.pongCh
+		c.connM.Unlock()
+
+		select {
+		case <-pongCh:
+			missed = 0
+			continue
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+
+		missed++
+		logger.Warnf("keepalive: missed pong %d/%d", missed, maxMissedPongs)
+		if missed < maxMissedPongs {
+			continue
+		}
+
+		logger.Warnf("keepalive: %d consecutive pongs missed, closing connection", missed)
+		// closeAndWait blocks until the old read loop's closeHandler (Facade's
+		// unsubscribe) has run, so reconnectWithBackoff's resubscribe below
+		// can never race it.
+		c.closeAndWait()
+		if !reconnect || c.redial == nil {
+			return
+		}
+		if !c.reconnectWithBackoff(ctx) {
+			return
+		}
+		missed = 0
+	}
+}
+
+// reconnectWithBackoff redials with exponential backoff until it succeeds or
+// ctx is canceled, returning false in the latter case. On success it calls
+// reconnectHandler so Facade can re-subscribe a client that the preceding
+// close (and its closeHandler) had unsubscribed.
+func (c *connTransport) reconnectWithBackoff(ctx context.Context) bool {
+	backoff := defaultKeepaliveBackoff
+	for {
+		conn, err := c.redial()
+		if err == nil {
+			logger.Infof("keepalive: reconnected")
+			c.bind(conn)
+			c.connM.Lock()
+			reconnectHandler := c.reconnectHandler
+			c.connM.Unlock()
+			if reconnectHandler != nil {
+				reconnectHandler()
+			}
+			return true
+		}
+		logger.Warnf("keepalive: reconnect failed, retrying in %s: %v", backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return false
+		}
+
+		backoff *= 2
+		if backoff > maxKeepaliveBackoff {
+			backoff = maxKeepaliveBackoff
+		}
+	}
+}
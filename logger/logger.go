@@ -0,0 +1,57 @@
+// Package logger is the injectable logging surface for gopherlua-debugger.
+// Embedders that want the package's logs folded into their own (e.g. a
+// logrus instance already used by the host program) call UseLogger; by
+// default everything goes to a private stderr logger that never touches
+// the standard library's global log.Logger, so installing it can't clobber
+// flags or output the host program relies on.
+package logger
+
+import (
+	"log"
+	"os"
+)
+
+// Logger is logrus-compatible: *logrus.Logger and *logrus.Entry both
+// satisfy it as-is.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+var current Logger = newDefaultLogger()
+
+// UseLogger redirects the package's logging to l.
+func UseLogger(l Logger) {
+	current = l
+}
+
+func Debugf(format string, args ...interface{}) { current.Debugf(format, args...) }
+func Infof(format string, args ...interface{})  { current.Infof(format, args...) }
+func Warnf(format string, args ...interface{})  { current.Warnf(format, args...) }
+func Errorf(format string, args ...interface{}) { current.Errorf(format, args...) }
+
+type defaultLogger struct {
+	l *log.Logger
+}
+
+func newDefaultLogger() *defaultLogger {
+	return &defaultLogger{l: log.New(os.Stderr, "[emmy] ", log.Ldate|log.Ltime|log.Lshortfile)}
+}
+
+func (d *defaultLogger) Debugf(format string, args ...interface{}) {
+	d.l.Printf("DEBUG "+format, args...)
+}
+
+func (d *defaultLogger) Infof(format string, args ...interface{}) {
+	d.l.Printf("INFO "+format, args...)
+}
+
+func (d *defaultLogger) Warnf(format string, args ...interface{}) {
+	d.l.Printf("WARN "+format, args...)
+}
+
+func (d *defaultLogger) Errorf(format string, args ...interface{}) {
+	d.l.Printf("ERROR "+format, args...)
+}
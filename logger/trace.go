@@ -0,0 +1,43 @@
+package logger
+
+import (
+	"os"
+	"strings"
+)
+
+// Category is one of the comma-separated flags accepted by the EMMY_TRACE
+// env var, e.g. EMMY_TRACE=proto,eval turns on wire-level tracing for just
+// those two subsystems without recompiling.
+type Category string
+
+const (
+	CategoryProto       Category = "proto"
+	CategoryBreakpoints Category = "breakpoints"
+	CategoryEval        Category = "eval"
+	CategoryTransport   Category = "transport"
+)
+
+var enabledCategories = parseTraceEnv(os.Getenv("EMMY_TRACE"))
+
+func parseTraceEnv(v string) map[Category]bool {
+	enabled := make(map[Category]bool)
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			enabled[Category(part)] = true
+		}
+	}
+	return enabled
+}
+
+// Enabled reports whether cat was requested via EMMY_TRACE.
+func Enabled(cat Category) bool {
+	return enabledCategories[cat]
+}
+
+// Tracef logs at debug level, but only if cat was turned on via EMMY_TRACE.
+func Tracef(cat Category, format string, args ...interface{}) {
+	if Enabled(cat) {
+		Debugf("["+string(cat)+"] "+format, args...)
+	}
+}
@@ -0,0 +1,140 @@
+// Package proto holds the emmy debugger wire messages and the command ids
+// used to tag them on the length-prefixed transport.
+package proto
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	MsgIdInitReq = iota + 1
+	MsgIdReadyReq
+	MsgIdAddBreakPointReq
+	MsgIdRemoveBreakPointReq
+	MsgIdActionReq
+	MsgIdEvalReq
+	MsgIdBreakNotify
+	MsgIdEvalRsp
+	MsgIdPingReq
+	MsgIdPongRsp
+)
+
+// PingReq/PongRsp are the transport-level keepalive messages. The Transport
+// sends PingReq and intercepts PongRsp itself, so a PongRsp never reaches
+// Facade.HandleMsg; an inbound PingReq is passed on and HandleMsg ignores it.
+type PingReq struct{}
+
+type PongRsp struct{}
+
+type InitReq struct {
+	EmmyHelper string
+	Ext        []string
+}
+
+type BreakPoint struct {
+	File      string
+	Condition string
+	Line      int
+}
+
+type AddBreakPointReq struct {
+	Clear       bool
+	BreakPoints []*BreakPoint
+}
+
+type RemoveBreakPointReq struct {
+	BreakPoints []*BreakPoint
+}
+
+type ActionReq struct {
+	Action int
+}
+
+type EvalReq struct {
+	Expr       string
+	Seq        int
+	StackLevel int
+	Depth      int
+	CacheId    int
+}
+
+type Variable struct {
+	Name     string
+	Value    string
+	Type     string
+	NameType string
+}
+
+type Stack struct {
+	Level            int
+	File             string
+	FunctionName     string
+	Line             int
+	LocalVariables   []*Variable
+	UpvalueVariables []*Variable
+}
+
+type BreakNotify struct {
+	Stacks []Stack
+}
+
+type EvalRsp struct {
+	Seq     int
+	Success bool
+	Error   string
+	Value   *Variable
+}
+
+// Marshal encodes msg as the payload for cmd, wrapped in the {cmd, msg}
+// envelope Unmarshal expects. Messages are JSON today; the wire-level framing
+// (length prefix) lives in the transport.
+func Marshal(cmd int, msg interface{}) ([]byte, error) {
+	rawMsg, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		Cmd int             `json:"cmd"`
+		Msg json.RawMessage `json:"msg"`
+	}{Cmd: cmd, Msg: rawMsg})
+}
+
+// Unmarshal decodes a payload back into the concrete request type for its
+// command id, returning it as the interface{} Facade.HandleMsg dispatches on.
+func Unmarshal(buf []byte) (int, interface{}, error) {
+	var envelope struct {
+		Cmd int             `json:"cmd"`
+		Msg json.RawMessage `json:"msg"`
+	}
+	if err := json.Unmarshal(buf, &envelope); err != nil {
+		return 0, nil, err
+	}
+
+	var msg interface{}
+	switch envelope.Cmd {
+	case MsgIdInitReq:
+		msg = &InitReq{}
+	case MsgIdReadyReq:
+		return envelope.Cmd, nil, nil
+	case MsgIdAddBreakPointReq:
+		msg = &AddBreakPointReq{}
+	case MsgIdRemoveBreakPointReq:
+		msg = &RemoveBreakPointReq{}
+	case MsgIdActionReq:
+		msg = &ActionReq{}
+	case MsgIdEvalReq:
+		msg = &EvalReq{}
+	case MsgIdPingReq:
+		msg = &PingReq{}
+	case MsgIdPongRsp:
+		msg = &PongRsp{}
+	default:
+		return 0, nil, fmt.Errorf("proto: unknown command id %d", envelope.Cmd)
+	}
+
+	if err := json.Unmarshal(envelope.Msg, msg); err != nil {
+		return 0, nil, err
+	}
+	return envelope.Cmd, msg, nil
+}
@@ -0,0 +1,46 @@
+package proto
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestMarshalUnmarshalRoundTrip guards the wire envelope Marshal produces and
+// Unmarshal consumes: a frame Marshal writes must come back out of
+// Unmarshal as the same cmd and an equivalent message.
+func TestMarshalUnmarshalRoundTrip(t *testing.T) {
+	cases := []struct {
+		name string
+		cmd  int
+		msg  interface{}
+	}{
+		{"PingReq", MsgIdPingReq, &PingReq{}},
+		{"PongRsp", MsgIdPongRsp, &PongRsp{}},
+		{"InitReq", MsgIdInitReq, &InitReq{EmmyHelper: "helper", Ext: []string{"lua"}}},
+		{"AddBreakPointReq", MsgIdAddBreakPointReq, &AddBreakPointReq{
+			Clear:       true,
+			BreakPoints: []*BreakPoint{{File: "a.lua", Line: 10}},
+		}},
+		{"EvalReq", MsgIdEvalReq, &EvalReq{Expr: "x+1", Seq: 3, StackLevel: 1}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf, err := Marshal(tc.cmd, tc.msg)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+
+			cmd, msg, err := Unmarshal(buf)
+			if err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if cmd != tc.cmd {
+				t.Fatalf("cmd = %d, want %d", cmd, tc.cmd)
+			}
+			if !reflect.DeepEqual(msg, tc.msg) {
+				t.Fatalf("msg = %+v, want %+v", msg, tc.msg)
+			}
+		})
+	}
+}
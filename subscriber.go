@@ -0,0 +1,66 @@
+package lua_debugger
+
+import "github.com/edolphin-ydf/gopherlua-debugger/logger"
+
+// subscriberQueueSize bounds how many undelivered notifications a
+// subscriber's writer goroutine will buffer before publish starts dropping
+// for it, so one slow or stuck subscriber can't block delivery to the
+// others.
+const subscriberQueueSize = 32
+
+type outboundMsg struct {
+	cmd int
+	msg interface{}
+}
+
+// subscriber owns a Transport's outbound queue: publish enqueues without
+// blocking on the network, and run drains the queue onto t.Send on its own
+// goroutine. queue is never closed - close just signals stopCh, so a publish
+// racing unsubscribe can never send on a channel that's already been closed
+// out from under it.
+type subscriber struct {
+	t      Transport
+	queue  chan outboundMsg
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+func newSubscriber(t Transport) *subscriber {
+	s := &subscriber{
+		t:      t,
+		queue:  make(chan outboundMsg, subscriberQueueSize),
+		stopCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *subscriber) run() {
+	defer close(s.doneCh)
+	for {
+		select {
+		case m := <-s.queue:
+			s.t.Send(m.cmd, m.msg)
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// enqueue hands a notification to the subscriber's writer goroutine,
+// dropping it instead of blocking the caller (publish) if the subscriber is
+// too far behind to keep up, or if it has already been unsubscribed.
+func (s *subscriber) enqueue(cmd int, msg interface{}) {
+	select {
+	case s.queue <- outboundMsg{cmd: cmd, msg: msg}:
+	default:
+		logger.Warnf("subscriber: outbound queue full, dropping cmd=%d", cmd)
+	}
+}
+
+// close stops the writer goroutine. It does not close the underlying
+// Transport; callers already do that via Stop.
+func (s *subscriber) close() {
+	close(s.stopCh)
+}
@@ -0,0 +1,36 @@
+package lua_debugger
+
+import "net"
+
+// TcpTransport is the original Transport implementation: a raw TCP dial or
+// accept, framed with connTransport's length-prefixed proto messages.
+type TcpTransport struct {
+	connTransport
+}
+
+// Connect dials the IDE at addr ("host:port") and starts the read loop.
+func (t *TcpTransport) Connect(addr string) error {
+	t.redial = func() (net.Conn, error) { return net.Dial("tcp", addr) }
+	conn, err := t.redial()
+	if err != nil {
+		return err
+	}
+	t.bind(conn)
+	return nil
+}
+
+// Listen binds addr, accepts a single IDE connection and starts the read
+// loop. It blocks until a connection is accepted or the listener fails.
+func (t *TcpTransport) Listen(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	conn, err := ln.Accept()
+	ln.Close()
+	if err != nil {
+		return err
+	}
+	t.bind(conn)
+	return nil
+}
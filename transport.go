@@ -0,0 +1,44 @@
+package lua_debugger
+
+import (
+	"context"
+	"time"
+)
+
+// Transport abstracts the wire between the debuggee and the IDE: dial out to
+// an already-listening IDE, listen for one to attach, and exchange proto
+// messages over whatever the underlying connection is. TcpTransport and
+// UnixTransport length-prefix each message on the stream; WebSocketTransport
+// sends each message unprefixed as one binary websocket frame.
+// TcpTransport, UnixTransport and WebSocketTransport are the concrete
+// implementations; Facade only ever talks to this interface.
+type Transport interface {
+	Connect(addr string) error
+	Listen(addr string) error
+	Send(cmd int, msg interface{}) error
+	Close() error
+	SetHandler(handler func(cmd int, req interface{}))
+	// SetCloseHandler registers a callback invoked once the read loop exits,
+	// so Facade can unsubscribe a client that disconnected on its own
+	// (network drop, IDE closed) rather than only on an explicit Stop.
+	SetCloseHandler(handler func())
+	// SetReconnectHandler registers a callback invoked once EnableKeepalive's
+	// reconnect redials and rebinds successfully, so Facade can re-subscribe
+	// a client that a missed-pong close (and the resulting SetCloseHandler
+	// callback) had unsubscribed.
+	SetReconnectHandler(handler func())
+
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	Wait()
+	IsRunning() bool
+
+	// EnableKeepalive starts a ping/pong heartbeat under ctx: every interval
+	// it sends a MsgIdPingReq and expects a MsgIdPongRsp before the next
+	// tick. After maxMissedPongs consecutive misses it closes the
+	// connection, and if reconnect is set, redials the address last passed
+	// to Connect with exponential backoff. On a Transport that was never
+	// Connect-dialed there is nothing to redial, so it only pings and closes.
+	// An interval <= 0 disables it outright.
+	EnableKeepalive(ctx context.Context, interval time.Duration, maxMissedPongs int, reconnect bool)
+}
@@ -0,0 +1,44 @@
+package lua_debugger
+
+import (
+	"net"
+	"os"
+)
+
+// UnixTransport is a Transport over a Unix domain socket, for local IDE
+// attach without exposing a TCP port.
+type UnixTransport struct {
+	connTransport
+}
+
+// Connect dials the Unix socket at path and starts the read loop.
+func (t *UnixTransport) Connect(path string) error {
+	t.redial = func() (net.Conn, error) { return net.Dial("unix", path) }
+	conn, err := t.redial()
+	if err != nil {
+		return err
+	}
+	t.bind(conn)
+	return nil
+}
+
+// Listen binds the Unix socket at path, accepts a single IDE connection and
+// starts the read loop. It blocks until a connection is accepted or the
+// listener fails.
+func (t *UnixTransport) Listen(path string) error {
+	// Best-effort: clear a stale socket file left behind by a previous run
+	// that didn't shut down cleanly.
+	_ = os.Remove(path)
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	conn, err := ln.Accept()
+	ln.Close()
+	if err != nil {
+		return err
+	}
+	t.bind(conn)
+	return nil
+}
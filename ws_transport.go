@@ -0,0 +1,343 @@
+package lua_debugger
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/edolphin-ydf/gopherlua-debugger/logger"
+	"github.com/edolphin-ydf/gopherlua-debugger/proto"
+)
+
+// WebSocketTransport is a Transport that upgrades an HTTP connection and
+// speaks proto messages over binary websocket frames, one message per
+// frame. Websocket framing already preserves message boundaries, so unlike
+// connTransport there is no length prefix to add.
+type WebSocketTransport struct {
+	handler func(cmd int, req interface{})
+
+	// connM guards conn, doneCh, pongCh, closeHandler and reconnectHandler:
+	// bind reassigns the former three wholesale on every reconnect, and
+	// Facade sets the latter two only after dial has already started the
+	// read loop, while Send, Close, Stop, Wait and readLoop read all five
+	// from other goroutines. writeM is separate: it only serializes the
+	// bytes of concurrent Send calls against the conn connM last published.
+	connM            sync.Mutex
+	conn             *websocket.Conn
+	doneCh           chan struct{}
+	pongCh           chan struct{}
+	closeHandler     func()
+	reconnectHandler func()
+
+	writeM sync.Mutex
+
+	running atomic.Bool
+
+	// redial is set by Connect so EnableKeepalive's reconnect can redial the
+	// same URL; left nil by Listen, which has nothing to redial.
+	redial func() (*websocket.Conn, error)
+}
+
+func (t *WebSocketTransport) SetHandler(handler func(cmd int, req interface{})) {
+	t.handler = handler
+}
+
+func (t *WebSocketTransport) SetCloseHandler(handler func()) {
+	t.connM.Lock()
+	defer t.connM.Unlock()
+	t.closeHandler = handler
+}
+
+func (t *WebSocketTransport) SetReconnectHandler(handler func()) {
+	t.connM.Lock()
+	defer t.connM.Unlock()
+	t.reconnectHandler = handler
+}
+
+// Connect dials addr ("host:port") as a websocket client and starts the
+// read loop.
+func (t *WebSocketTransport) Connect(addr string) error {
+	u := url.URL{Scheme: "ws", Host: addr, Path: "/emmy"}
+	t.redial = func() (*websocket.Conn, error) {
+		conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+		return conn, err
+	}
+	conn, err := t.redial()
+	if err != nil {
+		return err
+	}
+	t.bind(conn)
+	return nil
+}
+
+// Listen starts a minimal HTTP server on addr, upgrades the first request to
+// "/emmy" to a websocket, and starts the read loop. It blocks until a
+// connection is accepted or the server fails to start.
+func (t *WebSocketTransport) Listen(addr string) error {
+	upgrader := websocket.Upgrader{}
+	connCh := make(chan *websocket.Conn, 1)
+	errCh := make(chan error, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/emmy", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		connCh <- conn
+	})
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errCh <- err
+		}
+	}()
+
+	select {
+	case conn := <-connCh:
+		t.bind(conn)
+		go srv.Close()
+		return nil
+	case err := <-errCh:
+		srv.Close()
+		return err
+	}
+}
+
+func (t *WebSocketTransport) bind(conn *websocket.Conn) {
+	t.connM.Lock()
+	t.conn = conn
+	t.doneCh = make(chan struct{})
+	t.pongCh = make(chan struct{}, 1)
+	t.connM.Unlock()
+	go t.readLoop(conn)
+}
+
+func (t *WebSocketTransport) readLoop(conn *websocket.Conn) {
+	t.connM.Lock()
+	doneCh, pongCh := t.doneCh, t.pongCh
+	t.connM.Unlock()
+
+	// Deferred LIFO: closeHandler (Facade's unsubscribe) must run before
+	// doneCh closes, so closeAndWait can rely on it having already run by
+	// the time doneCh is observed closed.
+	defer close(doneCh)
+	defer func() {
+		t.connM.Lock()
+		closeHandler := t.closeHandler
+		t.connM.Unlock()
+		if closeHandler != nil {
+			closeHandler()
+		}
+	}()
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			logger.Tracef(logger.CategoryTransport, "read loop exiting: %v", err)
+			return
+		}
+		cmd, msg, err := proto.Unmarshal(data)
+		if err != nil {
+			logger.Tracef(logger.CategoryTransport, "read loop exiting: %v", err)
+			return
+		}
+		// Keepalive pongs are consumed here; they never reach Facade.
+		if cmd == proto.MsgIdPongRsp {
+			select {
+			case pongCh <- struct{}{}:
+			default:
+			}
+			continue
+		}
+		if t.handler != nil {
+			t.handler(cmd, msg)
+		}
+	}
+}
+
+func (t *WebSocketTransport) Send(cmd int, msg interface{}) error {
+	t.connM.Lock()
+	conn := t.conn
+	t.connM.Unlock()
+	if conn == nil {
+		return fmt.Errorf("transport: not connected")
+	}
+
+	t.writeM.Lock()
+	defer t.writeM.Unlock()
+	logger.Tracef(logger.CategoryTransport, "send cmd=%d", cmd)
+	buf, err := proto.Marshal(cmd, msg)
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(websocket.BinaryMessage, buf)
+}
+
+func (t *WebSocketTransport) Close() error {
+	t.connM.Lock()
+	conn := t.conn
+	t.connM.Unlock()
+	if conn == nil {
+		return nil
+	}
+	return conn.Close()
+}
+
+func (t *WebSocketTransport) Start(ctx context.Context) error {
+	t.running.Store(true)
+	return nil
+}
+
+func (t *WebSocketTransport) Stop(ctx context.Context) error {
+	if !t.running.CompareAndSwap(true, false) {
+		return nil
+	}
+	if err := t.Close(); err != nil {
+		return err
+	}
+
+	t.connM.Lock()
+	doneCh := t.doneCh
+	t.connM.Unlock()
+	if doneCh == nil {
+		return nil
+	}
+	select {
+	case <-doneCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *WebSocketTransport) Wait() {
+	t.connM.Lock()
+	doneCh := t.doneCh
+	t.connM.Unlock()
+	if doneCh != nil {
+		<-doneCh
+	}
+}
+
+// closeAndWait closes the current connection and blocks until its read loop
+// (and the closeHandler it runs) has fully exited, so a subsequent bind
+// can't race the old loop's access to doneCh/pongCh and callers can rely on
+// closeHandler having already run before they act on the close.
+func (t *WebSocketTransport) closeAndWait() {
+	t.connM.Lock()
+	doneCh := t.doneCh
+	t.connM.Unlock()
+	t.Close()
+	if doneCh != nil {
+		<-doneCh
+	}
+}
+
+func (t *WebSocketTransport) IsRunning() bool {
+	return t.running.Load()
+}
+
+// EnableKeepalive implements Transport.EnableKeepalive. It mirrors
+// connTransport's keepalive loop in keepalive.go; WebSocketTransport can't
+// embed connTransport since it wraps a *websocket.Conn rather than a
+// net.Conn, so the loop is duplicated here at websocket-frame granularity.
+func (t *WebSocketTransport) EnableKeepalive(ctx context.Context, interval time.Duration, maxMissedPongs int, reconnect bool) {
+	if interval <= 0 {
+		return
+	}
+	if maxMissedPongs <= 0 {
+		maxMissedPongs = 1
+	}
+	go t.keepaliveLoop(ctx, interval, maxMissedPongs, reconnect)
+}
+
+func (t *WebSocketTransport) keepaliveLoop(ctx context.Context, interval time.Duration, maxMissedPongs int, reconnect bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	missed := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := t.Send(proto.MsgIdPingReq, &proto.PingReq{}); err != nil {
+			logger.Tracef(logger.CategoryTransport, "keepalive: ping failed: %v", err)
+		}
+
+		t.connM.Lock()
+		pongCh := t.pongCh
+		t.connM.Unlock()
+
+		select {
+		case <-pongCh:
+			missed = 0
+			continue
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+
+		missed++
+		logger.Warnf("keepalive: missed pong %d/%d", missed, maxMissedPongs)
+		if missed < maxMissedPongs {
+			continue
+		}
+
+		logger.Warnf("keepalive: %d consecutive pongs missed, closing connection", missed)
+		// closeAndWait blocks until the old read loop's closeHandler (Facade's
+		// unsubscribe) has run, so reconnectWithBackoff's resubscribe below
+		// can never race it.
+		t.closeAndWait()
+		if !reconnect || t.redial == nil {
+			return
+		}
+		if !t.reconnectWithBackoff(ctx) {
+			return
+		}
+		missed = 0
+	}
+}
+
+// reconnectWithBackoff redials with exponential backoff until it succeeds or
+// ctx is canceled, returning false in the latter case. On success it calls
+// reconnectHandler so Facade can re-subscribe a client that the preceding
+// close (and its closeHandler) had unsubscribed.
+func (t *WebSocketTransport) reconnectWithBackoff(ctx context.Context) bool {
+	backoff := defaultKeepaliveBackoff
+	for {
+		conn, err := t.redial()
+		if err == nil {
+			logger.Infof("keepalive: reconnected")
+			t.bind(conn)
+			t.connM.Lock()
+			reconnectHandler := t.reconnectHandler
+			t.connM.Unlock()
+			if reconnectHandler != nil {
+				reconnectHandler()
+			}
+			return true
+		}
+		logger.Warnf("keepalive: reconnect failed, retrying in %s: %v", backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return false
+		}
+
+		backoff *= 2
+		if backoff > maxKeepaliveBackoff {
+			backoff = maxKeepaliveBackoff
+		}
+	}
+}